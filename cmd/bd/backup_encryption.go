@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/steveyegge/beads/internal/config"
+)
+
+// Sensitive wraps key material so it can be carried around in structs and
+// error values without ever being printed or logged in full. Both String
+// and GoString redact everything except whether a key is present.
+type Sensitive []byte
+
+// String implements fmt.Stringer, redacting the key material.
+func (s Sensitive) String() string { return s.redacted() }
+
+// GoString implements fmt.GoStringer, redacting the key material for %#v too.
+func (s Sensitive) GoString() string { return s.redacted() }
+
+func (s Sensitive) redacted() string {
+	if len(s) == 0 {
+		return "Sensitive(<empty>)"
+	}
+	return "Sensitive(<redacted>)"
+}
+
+// KeyProvider resolves the AEAD key used to encrypt and decrypt backup files.
+// Implementations must never log the key returned by Key.
+type KeyProvider interface {
+	// Provider identifies the kind of provider ("env", "file", "vault"),
+	// recorded per encrypted file in backup_manifest.json and
+	// ops_manifest.json (backup_state.json does not record it).
+	Provider() string
+	// KeyID identifies which key within the provider was used (an env var
+	// name, a file path, or a Vault KV path), recorded alongside Provider.
+	KeyID() string
+	// Key returns the raw AES-256 key.
+	Key(ctx context.Context) (Sensitive, error)
+}
+
+// encryptionState records which KeyProvider produced a backup's encrypted
+// files, so restore can select the matching key without guessing.
+type encryptionState struct {
+	Provider string `json:"provider"`
+	KeyID    string `json:"key_id"`
+	Cipher   string `json:"cipher"`
+}
+
+// newKeyProvider parses the "backup.encryption-key-source" config value into
+// a KeyProvider. Supported forms:
+//
+//	env:VAR_NAME                 base64 key read from an environment variable
+//	file:/path/to/keyfile        base64 key read from a 0600 keyfile
+//	vault:secret/path#field      data key fetched from HashiCorp Vault KV
+func newKeyProvider(spec string) (KeyProvider, error) {
+	kind, rest, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid backup.encryption-key-source %q: expected kind:value", spec)
+	}
+	switch kind {
+	case "env":
+		return &envKeyProvider{envVar: rest}, nil
+	case "file":
+		return &fileKeyProvider{path: rest}, nil
+	case "vault":
+		path, field, ok := strings.Cut(rest, "#")
+		if !ok {
+			field = "key"
+		}
+		return &vaultKeyProvider{path: path, field: field}, nil
+	default:
+		return nil, fmt.Errorf("unknown backup.encryption-key-source kind %q", kind)
+	}
+}
+
+// envKeyProvider reads a base64-encoded AES-256 key from an environment variable.
+type envKeyProvider struct{ envVar string }
+
+func (p *envKeyProvider) Provider() string { return "env" }
+func (p *envKeyProvider) KeyID() string    { return p.envVar }
+
+func (p *envKeyProvider) Key(_ context.Context) (Sensitive, error) {
+	raw := os.Getenv(p.envVar)
+	if raw == "" {
+		return nil, fmt.Errorf("env key provider: %s is not set", p.envVar)
+	}
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("env key provider: %s is not valid base64: %w", p.envVar, err)
+	}
+	return Sensitive(key), nil
+}
+
+// fileKeyProvider reads a base64-encoded AES-256 key from a keyfile that
+// must be mode 0600 (or stricter) so the key isn't world- or group-readable.
+type fileKeyProvider struct{ path string }
+
+func (p *fileKeyProvider) Provider() string { return "file" }
+func (p *fileKeyProvider) KeyID() string    { return p.path }
+
+func (p *fileKeyProvider) Key(_ context.Context) (Sensitive, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("file key provider: %w", err)
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("file key provider: %s must not be readable by group or others (mode %04o)", p.path, info.Mode().Perm())
+	}
+	raw, err := os.ReadFile(p.path) //nolint:gosec // path is operator-configured, mode is checked above
+	if err != nil {
+		return nil, fmt.Errorf("file key provider: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("file key provider: %s is not valid base64: %w", p.path, err)
+	}
+	return Sensitive(key), nil
+}
+
+// vaultKeyProvider fetches a data key from a HashiCorp Vault KV v2 path,
+// using a token from the VAULT_TOKEN env var and an address from VAULT_ADDR,
+// similar to how enterprise backup tooling pulls encryption keys from Vault.
+type vaultKeyProvider struct {
+	path  string
+	field string
+}
+
+func (p *vaultKeyProvider) Provider() string { return "vault" }
+func (p *vaultKeyProvider) KeyID() string    { return p.path + "#" + p.field }
+
+func (p *vaultKeyProvider) Key(ctx context.Context) (Sensitive, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	token := os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return nil, fmt.Errorf("vault key provider: VAULT_ADDR and VAULT_TOKEN must both be set")
+	}
+
+	url := strings.TrimRight(addr, "/") + "/v1/" + strings.TrimLeft(p.path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("vault key provider: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault key provider: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault key provider: %s returned %s", p.path, resp.Status)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("vault key provider: failed to decode response: %w", err)
+	}
+	raw, ok := body.Data.Data[p.field]
+	if !ok {
+		return nil, fmt.Errorf("vault key provider: field %q not found at %s", p.field, p.path)
+	}
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("vault key provider: field %q is not valid base64: %w", p.field, err)
+	}
+	return Sensitive(key), nil
+}
+
+// gcmNonceSize is the standard AES-GCM nonce size in bytes.
+const gcmNonceSize = 12
+
+// encryptFrame seals plaintext with AES-256-GCM under key using a fresh
+// random nonce, and frames the result as [4-byte big-endian len][nonce][ciphertext+tag].
+// Every backup file is written as a single frame by writeJSONLFile, but the
+// framing still allows a file to hold multiple concatenated frames if that
+// ever changes, which decryptFrames reads back one at a time.
+func encryptFrame(key Sensitive, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	nonce := make([]byte, gcmNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := gcm.Seal(nil, nonce, plaintext, nil)
+
+	frame := make([]byte, 4+gcmNonceSize+len(sealed))
+	binary.BigEndian.PutUint32(frame[:4], uint32(gcmNonceSize+len(sealed)))
+	copy(frame[4:4+gcmNonceSize], nonce)
+	copy(frame[4+gcmNonceSize:], sealed)
+	return frame, nil
+}
+
+// decryptFrames reads a file written by encryptFrame (one or more
+// concatenated frames) and returns the concatenated plaintext of each frame.
+func decryptFrames(key Sensitive, r io.Reader) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	var out []byte
+	lenBuf := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, lenBuf); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("failed to read frame length: %w", err)
+		}
+		frameLen := binary.BigEndian.Uint32(lenBuf)
+		frame := make([]byte, frameLen)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return nil, fmt.Errorf("failed to read frame: %w", err)
+		}
+		if int(frameLen) < gcmNonceSize {
+			return nil, fmt.Errorf("corrupt frame: length %d shorter than nonce", frameLen)
+		}
+		nonce, ciphertext := frame[:gcmNonceSize], frame[gcmNonceSize:]
+		plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt frame: %w", err)
+		}
+		out = append(out, plaintext...)
+	}
+	return out, nil
+}
+
+// currentKeyProvider resolves the KeyProvider configured via
+// "backup.encryption-key-source", or returns nil if encryption is not
+// configured for this backup.
+func currentKeyProvider() (KeyProvider, error) {
+	spec := config.GetString("backup.encryption-key-source")
+	if spec == "" {
+		return nil, nil
+	}
+	return newKeyProvider(spec)
+}
+
+// encryptForBackup encrypts plaintext as a single framed record using kp's
+// key, for use by writeJSONLFile.
+func encryptForBackup(kp KeyProvider, plaintext []byte) ([]byte, error) {
+	key, err := kp.Key(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("backup encryption key must be 32 bytes (AES-256), got %d", len(key))
+	}
+	return encryptFrame(key, plaintext)
+}
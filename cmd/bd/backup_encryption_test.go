@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncryptFrameRoundTrip(t *testing.T) {
+	key := Sensitive(bytes.Repeat([]byte{0x42}, 32))
+	plaintext := []byte("hello, backup")
+
+	frame, err := encryptFrame(key, plaintext)
+	if err != nil {
+		t.Fatalf("encryptFrame: %v", err)
+	}
+
+	got, err := decryptFrames(key, bytes.NewReader(frame))
+	if err != nil {
+		t.Fatalf("decryptFrames: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Fatalf("round trip mismatch: got %q, want %q", got, plaintext)
+	}
+}
+
+func TestDecryptFramesConcatenated(t *testing.T) {
+	key := Sensitive(bytes.Repeat([]byte{0x7a}, 32))
+	var combined []byte
+	for _, s := range []string{"first", "second", "third"} {
+		frame, err := encryptFrame(key, []byte(s))
+		if err != nil {
+			t.Fatalf("encryptFrame: %v", err)
+		}
+		combined = append(combined, frame...)
+	}
+
+	got, err := decryptFrames(key, bytes.NewReader(combined))
+	if err != nil {
+		t.Fatalf("decryptFrames: %v", err)
+	}
+	if string(got) != "firstsecondthird" {
+		t.Fatalf("decryptFrames returned %q", got)
+	}
+}
+
+func TestDecryptFramesWrongKeyFails(t *testing.T) {
+	key := Sensitive(bytes.Repeat([]byte{0x01}, 32))
+	wrongKey := Sensitive(bytes.Repeat([]byte{0x02}, 32))
+
+	frame, err := encryptFrame(key, []byte("secret"))
+	if err != nil {
+		t.Fatalf("encryptFrame: %v", err)
+	}
+
+	if _, err := decryptFrames(wrongKey, bytes.NewReader(frame)); err == nil {
+		t.Fatal("expected decryption with the wrong key to fail")
+	}
+}
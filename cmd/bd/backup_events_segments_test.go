@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEventsSegmentsSortedAscending(t *testing.T) {
+	s := &fileSink{dir: t.TempDir()}
+	for _, name := range []string{"events/000003.jsonl", "events/000001.jsonl", "events/000002.jsonl", "issues.jsonl"} {
+		if err := s.AtomicWrite(name, []byte("x")); err != nil {
+			t.Fatalf("AtomicWrite(%s): %v", name, err)
+		}
+	}
+
+	segments, err := eventsSegments(s)
+	if err != nil {
+		t.Fatalf("eventsSegments: %v", err)
+	}
+	want := []string{"events/000001.jsonl", "events/000002.jsonl", "events/000003.jsonl"}
+	if !reflect.DeepEqual(segments, want) {
+		t.Fatalf("eventsSegments() = %v, want %v", segments, want)
+	}
+}
+
+func TestEventsSegmentsFallsBackToLegacyFlatFile(t *testing.T) {
+	s := &fileSink{dir: t.TempDir()}
+	if err := s.AtomicWrite(legacyEventsFilename, []byte("x")); err != nil {
+		t.Fatalf("AtomicWrite: %v", err)
+	}
+
+	segments, err := eventsSegments(s)
+	if err != nil {
+		t.Fatalf("eventsSegments: %v", err)
+	}
+	want := []string{legacyEventsFilename}
+	if !reflect.DeepEqual(segments, want) {
+		t.Fatalf("eventsSegments() = %v, want %v", segments, want)
+	}
+}
+
+func TestEventsSegmentsIgnoresLegacyFileWhenSegmentsExist(t *testing.T) {
+	s := &fileSink{dir: t.TempDir()}
+	if err := s.AtomicWrite(legacyEventsFilename, []byte("x")); err != nil {
+		t.Fatalf("AtomicWrite: %v", err)
+	}
+	if err := s.AtomicWrite("events/000001.jsonl", []byte("x")); err != nil {
+		t.Fatalf("AtomicWrite: %v", err)
+	}
+
+	segments, err := eventsSegments(s)
+	if err != nil {
+		t.Fatalf("eventsSegments: %v", err)
+	}
+	want := []string{"events/000001.jsonl"}
+	if !reflect.DeepEqual(segments, want) {
+		t.Fatalf("eventsSegments() = %v, want %v", segments, want)
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/steveyegge/beads/internal/backup/migrations"
 	"github.com/steveyegge/beads/internal/beads"
 	"github.com/steveyegge/beads/internal/config"
 	"github.com/steveyegge/beads/internal/debug"
@@ -35,11 +37,17 @@ type backupState struct {
 		Labels       int `json:"labels"`
 		Config       int `json:"config"`
 	} `json:"counts"`
+	// SchemaVersion is the newest migrations.Migration ID known at export
+	// time, letting restore run migrations.Apply to bring older backups'
+	// rows up to the current schema. Migrations only run forward: rows of a
+	// backup newer than the restoring binary pass through unchanged.
+	SchemaVersion int `json:"schema_version"`
 }
 
-// backupDir returns the backup directory path, creating it if needed.
+// backupDir returns the local backup directory path, creating it if needed.
 // When backup.git-repo is set to a valid git repo, returns a backup/ subdirectory
-// inside that repo. Otherwise falls back to .beads/backup/.
+// inside that repo. Otherwise falls back to .beads/backup/. This is also the
+// resolution newBackupSink uses for the default, file-scheme destination.
 func backupDir() (string, error) {
 	gitRepo := config.GetString("backup.git-repo")
 	if gitRepo != "" {
@@ -68,16 +76,21 @@ func backupDir() (string, error) {
 	return dir, nil
 }
 
-// loadBackupState reads the backup state file, returning a zero state if missing.
-func loadBackupState(dir string) (*backupState, error) {
-	path := filepath.Join(dir, "backup_state.json")
-	data, err := os.ReadFile(path) //nolint:gosec // path is constructed internally
+// loadBackupState reads backup_state.json from sink, returning a zero state
+// if it doesn't exist yet (first backup run).
+func loadBackupState(sink BackupSink) (*backupState, error) {
+	r, err := sink.Read("backup_state.json")
 	if os.IsNotExist(err) {
 		return &backupState{}, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to read backup state: %w", err)
 	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup state: %w", err)
+	}
 	var state backupState
 	if err := json.Unmarshal(data, &state); err != nil {
 		return nil, fmt.Errorf("failed to parse backup state: %w", err)
@@ -85,54 +98,89 @@ func loadBackupState(dir string) (*backupState, error) {
 	return &state, nil
 }
 
-// saveBackupState writes the backup state file atomically.
-func saveBackupState(dir string, state *backupState) error {
+// saveBackupState writes the backup state file atomically via sink.
+func saveBackupState(sink BackupSink, state *backupState) error {
 	data, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal backup state: %w", err)
 	}
-	return atomicWriteFile(filepath.Join(dir, "backup_state.json"), data)
+	return sink.AtomicWrite("backup_state.json", data)
 }
 
-// atomicWriteFile writes data to a temp file and renames it into place (crash-safe).
-func atomicWriteFile(path string, data []byte) error {
-	dir := filepath.Dir(path)
-	tmp, err := os.CreateTemp(dir, ".backup-tmp-*")
+// writeJSONLFile seals data with the configured KeyProvider (if any) and
+// writes it to name via sink.AtomicWrite. This is the JSONL-file counterpart
+// to saveBackupState: every backup data file goes through here so encryption
+// is applied uniformly regardless of which BackupSink is in play. It returns
+// the encryption descriptor actually used (nil if encryption isn't
+// configured), for the caller to record against this specific file: events
+// segments and ops packs are immutable once written, so a later key rotation
+// must not change how an earlier file is described.
+func writeJSONLFile(sink BackupSink, name string, data []byte) (*encryptionState, error) {
+	kp, err := currentKeyProvider()
 	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
+		return nil, fmt.Errorf("failed to resolve backup encryption key: %w", err)
+	}
+	var enc *encryptionState
+	if kp != nil {
+		data, err = encryptForBackup(kp, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt %s: %w", name, err)
+		}
+		enc = &encryptionState{Provider: kp.Provider(), KeyID: kp.KeyID(), Cipher: "AES-256-GCM"}
+	}
+	if err := sink.AtomicWrite(name, data); err != nil {
+		return nil, err
 	}
-	tmpPath := tmp.Name()
+	return enc, nil
+}
 
-	if _, err := tmp.Write(data); err != nil {
-		_ = tmp.Close()
-		_ = os.Remove(tmpPath)
-		return fmt.Errorf("failed to write temp file: %w", err)
+// readJSONLFile reads name from sink and, if enc is non-nil, decrypts it
+// with the key enc describes. Callers resolve enc per file (e.g. via
+// fileEncryption against a manifest) rather than from one global descriptor,
+// since different files can have been written under different keys after a
+// "backup.encryption-key-source" rotation.
+func readJSONLFile(sink BackupSink, name string, enc *encryptionState) ([]byte, error) {
+	r, err := sink.Read(name)
+	if err != nil {
+		return nil, err
 	}
-	if err := tmp.Sync(); err != nil {
-		_ = tmp.Close()
-		_ = os.Remove(tmpPath)
-		return fmt.Errorf("failed to sync temp file: %w", err)
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
 	}
-	if err := tmp.Close(); err != nil {
-		_ = os.Remove(tmpPath)
-		return fmt.Errorf("failed to close temp file: %w", err)
+	if enc == nil {
+		return data, nil
 	}
-	if err := os.Rename(tmpPath, path); err != nil {
-		_ = os.Remove(tmpPath)
-		return fmt.Errorf("failed to rename temp file: %w", err)
+
+	kp, err := newKeyProvider(enc.Provider + ":" + enc.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve backup encryption key: %w", err)
 	}
-	return nil
+	key, err := kp.Key(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve backup encryption key: %w", err)
+	}
+	plaintext, err := decryptFrames(key, strings.NewReader(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", name, err)
+	}
+	return plaintext, nil
 }
 
-// runBackupExport exports all tables to JSONL files in .beads/backup/.
-// Returns the updated state. Events are exported incrementally using the high-water mark.
+// runBackupExport exports all tables to JSONL files on the configured
+// BackupSink (a local .beads/backup/ directory by default, or S3/GCS/MinIO
+// when backup.destination is set). Returns the updated state. Events are
+// exported incrementally: each run writes only its new events as their own
+// numbered segment file, so no destination ever needs to mutate an existing
+// object.
 func runBackupExport(ctx context.Context, force bool) (*backupState, error) {
-	dir, err := backupDir()
+	sink, err := newBackupSink(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	state, err := loadBackupState(dir)
+	state, err := loadBackupState(sink)
 	if err != nil {
 		return nil, err
 	}
@@ -149,7 +197,29 @@ func runBackupExport(ctx context.Context, force bool) (*backupState, error) {
 		}
 	}
 
+	manifest, err := loadManifest(sink)
+	if err != nil {
+		return nil, err
+	}
+	// runBackupGC shrinks the manifest, so start past the highest events
+	// segment already on the sink rather than reuse (and overwrite) one.
+	runSeq := len(manifest.Entries) + 1
+	existingSegments, err := eventsSegments(sink)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range existingSegments {
+		var seq int
+		if _, err := fmt.Sscanf(name, "events/%d.jsonl", &seq); err == nil && seq >= runSeq {
+			runSeq = seq + 1
+		}
+	}
+	runID := fmt.Sprintf("run-%04d", runSeq)
+
 	hasWisps := tableExistsCheck(ctx, store, "wisps")
+	prevCommit := state.LastDoltCommit
+	prevEventID := state.LastEventID
+	var files []ManifestFile
 
 	// Export each table. Use SELECT * so we capture all columns (schema has 50+
 	// fields and grows over time). The dynamic column scanner handles this automatically.
@@ -157,18 +227,22 @@ func runBackupExport(ctx context.Context, force bool) (*backupState, error) {
 	if hasWisps {
 		issuesQuery = "SELECT * FROM issues UNION ALL SELECT * FROM wisps ORDER BY id"
 	}
-	n, err := exportTable(ctx, store, dir, "issues.jsonl", issuesQuery)
+	n, digest, err := exportTable(ctx, store, sink, "issues.jsonl", issuesQuery)
 	if err != nil {
 		return nil, fmt.Errorf("backup issues: %w", err)
 	}
 	state.Counts.Issues = n
+	files = append(files, ManifestFile(digest))
 
-	// Events: incremental append
-	n, err = exportEventsIncremental(ctx, store, dir, state, hasWisps)
+	// Events: each run writes only its new events, as their own segment.
+	n, digest, err = exportEventsSegment(ctx, store, sink, state, hasWisps, runSeq)
 	if err != nil {
 		return nil, fmt.Errorf("backup events: %w", err)
 	}
 	state.Counts.Events += n
+	if n > 0 {
+		files = append(files, ManifestFile(digest))
+	}
 
 	commentsQuery := "SELECT id, issue_id, author, text, created_at FROM comments ORDER BY id"
 	if hasWisps {
@@ -177,11 +251,12 @@ func runBackupExport(ctx context.Context, force bool) (*backupState, error) {
 			"SELECT id, issue_id, author, text, created_at FROM wisp_comments " +
 			"ORDER BY id"
 	}
-	n, err = exportTable(ctx, store, dir, "comments.jsonl", commentsQuery)
+	n, digest, err = exportTable(ctx, store, sink, "comments.jsonl", commentsQuery)
 	if err != nil {
 		return nil, fmt.Errorf("backup comments: %w", err)
 	}
 	state.Counts.Comments = n
+	files = append(files, ManifestFile(digest))
 
 	depsQuery := "SELECT issue_id, depends_on_id, type, created_at, created_by FROM dependencies ORDER BY issue_id, depends_on_id"
 	if hasWisps {
@@ -190,11 +265,12 @@ func runBackupExport(ctx context.Context, force bool) (*backupState, error) {
 			"SELECT issue_id, depends_on_id, type, created_at, created_by FROM wisp_dependencies " +
 			"ORDER BY issue_id, depends_on_id"
 	}
-	n, err = exportTable(ctx, store, dir, "dependencies.jsonl", depsQuery)
+	n, digest, err = exportTable(ctx, store, sink, "dependencies.jsonl", depsQuery)
 	if err != nil {
 		return nil, fmt.Errorf("backup dependencies: %w", err)
 	}
 	state.Counts.Dependencies = n
+	files = append(files, ManifestFile(digest))
 
 	labelsQuery := "SELECT issue_id, label FROM labels ORDER BY issue_id, label"
 	if hasWisps {
@@ -203,18 +279,28 @@ func runBackupExport(ctx context.Context, force bool) (*backupState, error) {
 			"SELECT issue_id, label FROM wisp_labels " +
 			"ORDER BY issue_id, label"
 	}
-	n, err = exportTable(ctx, store, dir, "labels.jsonl", labelsQuery)
+	n, digest, err = exportTable(ctx, store, sink, "labels.jsonl", labelsQuery)
 	if err != nil {
 		return nil, fmt.Errorf("backup labels: %w", err)
 	}
 	state.Counts.Labels = n
+	files = append(files, ManifestFile(digest))
 
-	n, err = exportTable(ctx, store, dir, "config.jsonl",
+	n, digest, err = exportTable(ctx, store, sink, "config.jsonl",
 		"SELECT `key`, value FROM config ORDER BY `key`")
 	if err != nil {
 		return nil, fmt.Errorf("backup config: %w", err)
 	}
 	state.Counts.Config = n
+	files = append(files, ManifestFile(digest))
+
+	// The operation log is a second, opt-in backup format alongside the row
+	// dumps above: see exportOpsLog for why it needs its own watermark.
+	if config.GetBool("backup.ops-log") {
+		if _, err := exportOpsLog(ctx, store, sink, hasWisps); err != nil {
+			return nil, fmt.Errorf("backup ops log: %w", err)
+		}
+	}
 
 	// Update watermarks
 	currentCommit, err := store.GetCurrentCommit(ctx)
@@ -224,10 +310,29 @@ func runBackupExport(ctx context.Context, force bool) (*backupState, error) {
 	state.LastDoltCommit = currentCommit
 	state.Timestamp = time.Now().UTC()
 
-	if err := saveBackupState(dir, state); err != nil {
+	schemaVersion, err := migrations.CurrentVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve backup schema version: %w", err)
+	}
+	state.SchemaVersion = schemaVersion
+
+	if err := saveBackupState(sink, state); err != nil {
 		return nil, err
 	}
 
+	entry := ManifestEntry{
+		RunID:          runID,
+		Timestamp:      state.Timestamp,
+		DoltCommit:     currentCommit,
+		PrevDoltCommit: prevCommit,
+		EventIDRange:   [2]int64{prevEventID, state.LastEventID},
+		Files:          files,
+		SchemaVersion:  schemaVersion,
+	}
+	if err := appendManifestEntry(sink, entry); err != nil {
+		return nil, fmt.Errorf("failed to append backup manifest entry: %w", err)
+	}
+
 	return state, nil
 }
 
@@ -241,6 +346,21 @@ func tableExistsCheck(ctx context.Context, q dbQuerier, table string) bool {
 	return rows.Next()
 }
 
+// ensureBackupTable creates table via ddl if it doesn't already exist.
+// backup_applied_ops and backup_migrations are bookkeeping tables owned by
+// the backup subsystem itself, not part of application schema, so the
+// backup code that needs them creates them on first use rather than
+// assuming some other migration already has.
+func ensureBackupTable(ctx context.Context, execer dbExecer, table, ddl string) error {
+	if tableExistsCheck(ctx, store, table) {
+		return nil
+	}
+	if _, err := execer.ExecContext(ctx, ddl); err != nil {
+		return fmt.Errorf("failed to create %s table: %w", table, err)
+	}
+	return nil
+}
+
 // truncateHash returns the first 8 characters of a hash, or the full string if shorter.
 func truncateHash(h string) string {
 	if len(h) > 8 {
@@ -249,18 +369,18 @@ func truncateHash(h string) string {
 	return h
 }
 
-// exportTable runs a query and writes each row as a JSON object to a JSONL file.
-// Returns the number of rows exported.
-func exportTable(ctx context.Context, q dbQuerier, dir, filename, query string) (int, error) {
+// exportTable runs a query and writes each row as a JSON object to a JSONL
+// file on sink. Returns the number of rows exported and that file's digest.
+func exportTable(ctx context.Context, q dbQuerier, sink BackupSink, filename, query string) (int, fileDigest, error) {
 	rows, err := q.QueryContext(ctx, query)
 	if err != nil {
-		return 0, fmt.Errorf("query failed: %w", err)
+		return 0, fileDigest{}, fmt.Errorf("query failed: %w", err)
 	}
 	defer rows.Close()
 
 	cols, err := rows.Columns()
 	if err != nil {
-		return 0, fmt.Errorf("failed to get columns: %w", err)
+		return 0, fileDigest{}, fmt.Errorf("failed to get columns: %w", err)
 	}
 
 	var lines []byte
@@ -274,7 +394,7 @@ func exportTable(ctx context.Context, q dbQuerier, dir, filename, query string)
 			ptrs[i] = &values[i]
 		}
 		if err := rows.Scan(ptrs...); err != nil {
-			return 0, fmt.Errorf("scan failed: %w", err)
+			return 0, fileDigest{}, fmt.Errorf("scan failed: %w", err)
 		}
 
 		// Build a map for JSON serialization
@@ -285,22 +405,33 @@ func exportTable(ctx context.Context, q dbQuerier, dir, filename, query string)
 
 		data, err := json.Marshal(row)
 		if err != nil {
-			return 0, fmt.Errorf("marshal failed: %w", err)
+			return 0, fileDigest{}, fmt.Errorf("marshal failed: %w", err)
 		}
 		lines = append(lines, data...)
 		lines = append(lines, '\n')
 		count++
 	}
 	if err := rows.Err(); err != nil {
-		return 0, fmt.Errorf("row iteration failed: %w", err)
+		return 0, fileDigest{}, fmt.Errorf("row iteration failed: %w", err)
 	}
 
-	return count, atomicWriteFile(filepath.Join(dir, filename), lines)
+	enc, err := writeJSONLFile(sink, filename, lines)
+	if err != nil {
+		return 0, fileDigest{}, err
+	}
+	digest, err := fileDigestFor(sink, filename)
+	if err != nil {
+		return 0, fileDigest{}, err
+	}
+	digest.Encryption = enc
+	return count, digest, nil
 }
 
-// exportEventsIncremental appends new events since the last high-water mark.
-// On first export (lastEventID=0), dumps all events as a full snapshot.
-func exportEventsIncremental(ctx context.Context, q dbQuerier, dir string, state *backupState, hasWisps bool) (int, error) {
+// exportEventsSegment exports events newer than state.LastEventID as their
+// own segment file, named events/<runSeq>.jsonl. Because each run's segment
+// is a brand-new object, cloud sinks never need to mutate an existing one;
+// restore replays segments in order to reconstruct the full event history.
+func exportEventsSegment(ctx context.Context, q dbQuerier, sink BackupSink, state *backupState, hasWisps bool, runSeq int) (int, fileDigest, error) {
 	query := "SELECT id, issue_id, event_type, actor, old_value, new_value, comment, created_at " +
 		"FROM events WHERE id > ? ORDER BY id ASC"
 	args := []interface{}{state.LastEventID}
@@ -317,16 +448,16 @@ func exportEventsIncremental(ctx context.Context, q dbQuerier, dir string, state
 
 	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
-		return 0, fmt.Errorf("query failed: %w", err)
+		return 0, fileDigest{}, fmt.Errorf("query failed: %w", err)
 	}
 	defer rows.Close()
 
 	cols, err := rows.Columns()
 	if err != nil {
-		return 0, fmt.Errorf("failed to get columns: %w", err)
+		return 0, fileDigest{}, fmt.Errorf("failed to get columns: %w", err)
 	}
 
-	var newLines []byte
+	var lines []byte
 	count := 0
 	var maxID int64
 
@@ -337,7 +468,7 @@ func exportEventsIncremental(ctx context.Context, q dbQuerier, dir string, state
 			ptrs[i] = &values[i]
 		}
 		if err := rows.Scan(ptrs...); err != nil {
-			return 0, fmt.Errorf("scan failed: %w", err)
+			return 0, fileDigest{}, fmt.Errorf("scan failed: %w", err)
 		}
 
 		row := make(map[string]interface{}, len(cols))
@@ -352,44 +483,39 @@ func exportEventsIncremental(ctx context.Context, q dbQuerier, dir string, state
 
 		data, err := json.Marshal(row)
 		if err != nil {
-			return 0, fmt.Errorf("marshal failed: %w", err)
+			return 0, fileDigest{}, fmt.Errorf("marshal failed: %w", err)
 		}
-		newLines = append(newLines, data...)
-		newLines = append(newLines, '\n')
+		lines = append(lines, data...)
+		lines = append(lines, '\n')
 		count++
 	}
 	if err := rows.Err(); err != nil {
-		return 0, fmt.Errorf("row iteration failed: %w", err)
+		return 0, fileDigest{}, fmt.Errorf("row iteration failed: %w", err)
 	}
 
 	if count == 0 {
-		return 0, nil
+		return 0, fileDigest{}, nil
 	}
 
-	// Append to existing events file (or create new)
-	eventsPath := filepath.Join(dir, "events.jsonl")
-	if state.LastEventID == 0 {
-		// First export: full snapshot via atomic write
-		if err := atomicWriteFile(eventsPath, newLines); err != nil {
-			return 0, err
-		}
-	} else {
-		// Incremental: append to existing file
-		f, err := os.OpenFile(eventsPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600) //nolint:gosec // path is constructed internally
-		if err != nil {
-			return 0, fmt.Errorf("failed to open events file: %w", err)
-		}
-		if _, err := f.Write(newLines); err != nil {
-			_ = f.Close()
-			return 0, fmt.Errorf("failed to append events: %w", err)
-		}
-		if err := f.Close(); err != nil {
-			return 0, fmt.Errorf("failed to close events file: %w", err)
-		}
+	name := eventsSegmentName(runSeq)
+	enc, err := writeJSONLFile(sink, name, lines)
+	if err != nil {
+		return 0, fileDigest{}, err
 	}
+	digest, err := fileDigestFor(sink, name)
+	if err != nil {
+		return 0, fileDigest{}, err
+	}
+	digest.Encryption = enc
 
 	state.LastEventID = maxID
-	return count, nil
+	return count, digest, nil
+}
+
+// eventsSegmentName returns the segment file name for the given run sequence
+// number, e.g. events/000123.jsonl.
+func eventsSegmentName(runSeq int) string {
+	return fmt.Sprintf("events/%06d.jsonl", runSeq)
 }
 
 // normalizeValue converts database driver types to JSON-friendly values.
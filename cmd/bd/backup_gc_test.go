@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+)
+
+func seedManifestEntry(t *testing.T, sink BackupSink, runID string, files ...string) {
+	t.Helper()
+	var manifestFiles []ManifestFile
+	for _, f := range files {
+		manifestFiles = append(manifestFiles, ManifestFile{Name: f, SHA256: "deadbeef"})
+	}
+	entry := ManifestEntry{RunID: runID, DoltCommit: runID + "-commit", Files: manifestFiles}
+	if err := appendManifestEntry(sink, entry); err != nil {
+		t.Fatalf("appendManifestEntry(%s): %v", runID, err)
+	}
+}
+
+func TestRunBackupGCKeepsEveryCollapsedEventsSegmentDigest(t *testing.T) {
+	s := &fileSink{dir: t.TempDir()}
+	seedManifestEntry(t, s, "run1", "issues.jsonl", "events/000001.jsonl")
+	seedManifestEntry(t, s, "run2", "issues.jsonl", "events/000002.jsonl")
+	seedManifestEntry(t, s, "run3", "issues.jsonl", "events/000003.jsonl")
+
+	m, err := runBackupGC(s, 1)
+	if err != nil {
+		t.Fatalf("runBackupGC: %v", err)
+	}
+	if len(m.Entries) != 2 {
+		t.Fatalf("len(m.Entries) = %d, want 2", len(m.Entries))
+	}
+
+	synthetic := m.Entries[0]
+	names := map[string]bool{}
+	for _, f := range synthetic.Files {
+		names[f.Name] = true
+	}
+	for _, want := range []string{"issues.jsonl", "events/000001.jsonl", "events/000002.jsonl"} {
+		if !names[want] {
+			t.Fatalf("synthetic entry missing file %q, got %v", want, synthetic.Files)
+		}
+	}
+	// Only the last collapsed run's (run2's) fixed-name file should survive, with no duplicate from run1.
+	count := 0
+	for _, f := range synthetic.Files {
+		if f.Name == "issues.jsonl" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Fatalf("synthetic entry has %d issues.jsonl entries, want 1", count)
+	}
+}
+
+func TestRunBackupGCNoOpWhenUnderKeepFull(t *testing.T) {
+	s := &fileSink{dir: t.TempDir()}
+	seedManifestEntry(t, s, "run1", "issues.jsonl")
+
+	m, err := runBackupGC(s, 2)
+	if err != nil {
+		t.Fatalf("runBackupGC: %v", err)
+	}
+	if len(m.Entries) != 1 {
+		t.Fatalf("len(m.Entries) = %d, want 1", len(m.Entries))
+	}
+	if m.Entries[0].RunID != "run1" {
+		t.Fatalf("runBackupGC collapsed an entry it shouldn't have: %v", m.Entries)
+	}
+}
+
+func TestRunBackupGCRejectsNonPositiveKeepFull(t *testing.T) {
+	s := &fileSink{dir: t.TempDir()}
+	if _, err := runBackupGC(s, 0); err == nil {
+		t.Fatal("runBackupGC(0): expected an error, got nil")
+	}
+}
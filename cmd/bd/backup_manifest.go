@@ -0,0 +1,312 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// fileDigest is the checksum/size info exportTable and exportEventsSegment
+// compute for the file they just wrote, used to build a ManifestFile entry.
+type fileDigest struct {
+	Name                 string
+	SHA256               string
+	Size                 int64
+	BytesAppendedThisRun int64
+	Encryption           *encryptionState
+}
+
+// ManifestFile is one file entry in a backup_manifest.json run. Encryption
+// records which key (if any) sealed this specific file: issues.jsonl and
+// friends are overwritten every run, but events/NNNNNN.jsonl segments are
+// immutable, so the key in effect when an older segment was written can
+// differ from the key in effect for a later run — each file must carry its
+// own. backupState itself records no encryption descriptor.
+type ManifestFile struct {
+	Name                 string           `json:"name"`
+	SHA256               string           `json:"sha256"`
+	Size                 int64            `json:"size"`
+	BytesAppendedThisRun int64            `json:"bytes_appended_this_run"`
+	Encryption           *encryptionState `json:"encryption,omitempty"`
+}
+
+// fileEncryption looks up the encryption descriptor recorded for name,
+// scanning the manifest newest-entry-first. Fixed-name files (issues.jsonl,
+// comments.jsonl, ...) are overwritten every run, so the most recent entry
+// reflects what's actually on disk; immutable per-run files (events
+// segments, ops packs) have exactly one entry naming them either way.
+func fileEncryption(m *backupManifest, name string) *encryptionState {
+	for i := len(m.Entries) - 1; i >= 0; i-- {
+		for _, f := range m.Entries[i].Files {
+			if f.Name == name {
+				return f.Encryption
+			}
+		}
+	}
+	return nil
+}
+
+// ManifestEntry records one runBackupExport invocation. Entries chain via
+// PrevDoltCommit so `beads backup verify` can walk the chain and `beads
+// backup gc` can tell which incrementals are safe to collapse.
+type ManifestEntry struct {
+	RunID          string         `json:"run_id"`
+	Timestamp      time.Time      `json:"timestamp"`
+	DoltCommit     string         `json:"dolt_commit"`
+	PrevDoltCommit string         `json:"prev_dolt_commit"`
+	EventIDRange   [2]int64       `json:"event_id_range"`
+	Files          []ManifestFile `json:"files"`
+	SchemaVersion  int            `json:"schema_version"`
+}
+
+// backupManifest is the full chain of manifest entries, one per
+// runBackupExport invocation, stored in backup_manifest.json alongside
+// backup_state.json.
+type backupManifest struct {
+	Entries []ManifestEntry `json:"entries"`
+}
+
+const manifestFilename = "backup_manifest.json"
+
+// loadManifest reads backup_manifest.json from sink, returning an empty
+// manifest if it doesn't exist yet (first backup run).
+func loadManifest(sink BackupSink) (*backupManifest, error) {
+	r, err := sink.Read(manifestFilename)
+	if os.IsNotExist(err) {
+		return &backupManifest{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup manifest: %w", err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup manifest: %w", err)
+	}
+	var m backupManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse backup manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// appendManifestEntry appends entry to backup_manifest.json, writing the
+// whole chain back out atomically via sink.
+func appendManifestEntry(sink BackupSink, entry ManifestEntry) error {
+	m, err := loadManifest(sink)
+	if err != nil {
+		return err
+	}
+	m.Entries = append(m.Entries, entry)
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup manifest: %w", err)
+	}
+	return sink.AtomicWrite(manifestFilename, data)
+}
+
+// sha256Hex returns the hex-encoded SHA-256 of data.
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// fileDigestFor reads and hashes name as it exists on sink (post-encryption,
+// if configured), for recording in a ManifestFile entry. Every backup data
+// file is a complete, immutable artifact for its run (including per-run
+// events segments), so the digest always covers the whole file.
+func fileDigestFor(sink BackupSink, name string) (fileDigest, error) {
+	r, err := sink.Read(name)
+	if err != nil {
+		return fileDigest{}, fmt.Errorf("failed to read %s for manifest: %w", name, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fileDigest{}, fmt.Errorf("failed to read %s for manifest: %w", name, err)
+	}
+	return fileDigest{Name: name, SHA256: sha256Hex(data), Size: int64(len(data)), BytesAppendedThisRun: int64(len(data))}, nil
+}
+
+// verifyResult is one file's outcome from `beads backup verify`.
+type verifyResult struct {
+	RunID string
+	File  string
+	OK    bool
+	Err   error
+}
+
+// runBackupVerify walks the manifest chain on sink, re-hashing each file
+// against the newest entry that names it and reporting the first broken link
+// it finds. Fixed-name files are overwritten every run, so older entries'
+// digests for the same name are skipped.
+func runBackupVerify(sink BackupSink) ([]verifyResult, error) {
+	m, err := loadManifest(sink)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := map[string]int{}
+	for i, entry := range m.Entries {
+		for _, file := range entry.Files {
+			latest[file.Name] = i
+		}
+	}
+
+	var results []verifyResult
+	for i, entry := range m.Entries {
+		for _, file := range entry.Files {
+			if latest[file.Name] != i {
+				continue
+			}
+			r, err := sink.Read(file.Name)
+			if err != nil {
+				results = append(results, verifyResult{RunID: entry.RunID, File: file.Name, OK: false, Err: err})
+				return results, nil
+			}
+			data, err := io.ReadAll(r)
+			_ = r.Close()
+			if err != nil {
+				results = append(results, verifyResult{RunID: entry.RunID, File: file.Name, OK: false, Err: err})
+				return results, nil
+			}
+
+			got := sha256Hex(data)
+			ok := got == file.SHA256
+			results = append(results, verifyResult{RunID: entry.RunID, File: file.Name, OK: ok})
+			if !ok {
+				results[len(results)-1].Err = fmt.Errorf("sha256 mismatch: manifest has %s, disk has %s", file.SHA256, got)
+				return results, nil
+			}
+		}
+	}
+	return results, nil
+}
+
+// runBackupGC collapses all but the last keepFull manifest entries into a
+// single synthetic full-snapshot entry, so old incrementals can be pruned
+// without losing the ability to restore from the remaining chain. It never
+// touches the underlying JSONL files themselves, so it keeps every collapsed
+// entry's immutable events/NNNNNN.jsonl segment digest (not just the last
+// run's) alongside the last run's fixed-name file digests — those segments
+// are still on disk and still need to verify after gc.
+func runBackupGC(sink BackupSink, keepFull int) (*backupManifest, error) {
+	if keepFull < 1 {
+		return nil, fmt.Errorf("--keep-full must be at least 1")
+	}
+	m, err := loadManifest(sink)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Entries) <= keepFull {
+		return m, nil
+	}
+
+	collapse := m.Entries[:len(m.Entries)-keepFull]
+	kept := m.Entries[len(m.Entries)-keepFull:]
+
+	first, last := collapse[0], collapse[len(collapse)-1]
+	files := last.Files
+	seen := map[string]bool{}
+	for _, f := range files {
+		seen[f.Name] = true
+	}
+	for _, entry := range collapse[:len(collapse)-1] {
+		for _, f := range entry.Files {
+			if strings.HasPrefix(f.Name, "events/") && !seen[f.Name] {
+				files = append(files, f)
+				seen[f.Name] = true
+			}
+		}
+	}
+
+	synthetic := ManifestEntry{
+		RunID:          fmt.Sprintf("collapsed-%s..%s", first.RunID, last.RunID),
+		Timestamp:      last.Timestamp,
+		DoltCommit:     last.DoltCommit,
+		PrevDoltCommit: first.PrevDoltCommit,
+		EventIDRange:   [2]int64{first.EventIDRange[0], last.EventIDRange[1]},
+		Files:          files,
+		SchemaVersion:  last.SchemaVersion,
+	}
+
+	m.Entries = append([]ManifestEntry{synthetic}, kept...)
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal backup manifest: %w", err)
+	}
+	if err := sink.AtomicWrite(manifestFilename, data); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// backupCmd is the parent "beads backup" command that export, restore,
+// verify and gc all hang off of.
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Export, restore, and maintain database backups",
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+}
+
+var backupVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Walk the backup manifest chain and re-hash files, reporting the first broken link",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sink, err := newBackupSink(cmd.Context())
+		if err != nil {
+			return err
+		}
+		results, err := runBackupVerify(sink)
+		if err != nil {
+			return err
+		}
+		runs := map[string]bool{}
+		for _, r := range results {
+			runs[r.RunID] = true
+			if r.OK {
+				fmt.Fprintf(cmd.OutOrStdout(), "ok   %s %s\n", r.RunID, r.File)
+				continue
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "FAIL %s %s: %v\n", r.RunID, r.File, r.Err)
+			return fmt.Errorf("backup verify failed at run %s (%s)", r.RunID, r.File)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "verified %d file(s) across %d run(s)\n", len(results), len(runs))
+		return nil
+	},
+}
+
+var backupGCKeepFull int
+
+var backupGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Collapse old incremental manifest entries into a new full snapshot",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sink, err := newBackupSink(cmd.Context())
+		if err != nil {
+			return err
+		}
+		m, err := runBackupGC(sink, backupGCKeepFull)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "manifest now has %d entries\n", len(m.Entries))
+		return nil
+	},
+}
+
+func init() {
+	backupGCCmd.Flags().IntVar(&backupGCKeepFull, "keep-full", 1, "number of trailing manifest entries to keep uncollapsed")
+	backupCmd.AddCommand(backupVerifyCmd)
+	backupCmd.AddCommand(backupGCCmd)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMapEventToOpKnownTypes(t *testing.T) {
+	cases := []struct {
+		row         map[string]interface{}
+		wantType    string
+		wantPayload map[string]any
+	}{
+		{
+			row:      map[string]interface{}{"issue_id": "bd-1", "event_type": "created"},
+			wantType: "create_issue",
+			wantPayload: map[string]any{
+				"issue_id": "bd-1",
+			},
+		},
+		{
+			row:      map[string]interface{}{"issue_id": "bd-1", "event_type": "status_changed", "old_value": "open", "new_value": "closed"},
+			wantType: "set_status",
+			wantPayload: map[string]any{
+				"issue_id":   "bd-1",
+				"old_status": "open",
+				"new_status": "closed",
+			},
+		},
+		{
+			row:      map[string]interface{}{"issue_id": "bd-1", "event_type": "comment_added", "comment": "hi"},
+			wantType: "add_comment",
+			wantPayload: map[string]any{
+				"issue_id": "bd-1",
+				"comment":  "hi",
+			},
+		},
+		{
+			row:      map[string]interface{}{"issue_id": "bd-1", "event_type": "dependency_added", "new_value": "bd-2"},
+			wantType: "add_dependency",
+			wantPayload: map[string]any{
+				"issue_id":      "bd-1",
+				"depends_on_id": "bd-2",
+			},
+		},
+		{
+			row:      map[string]interface{}{"issue_id": "bd-1", "event_type": "label_added", "new_value": "bug"},
+			wantType: "add_label",
+			wantPayload: map[string]any{
+				"issue_id": "bd-1",
+				"label":    "bug",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		gotType, gotPayload := mapEventToOp(c.row)
+		if gotType != c.wantType {
+			t.Errorf("mapEventToOp(%v) type = %q, want %q", c.row, gotType, c.wantType)
+		}
+		if !reflect.DeepEqual(gotPayload, c.wantPayload) {
+			t.Errorf("mapEventToOp(%v) payload = %v, want %v", c.row, gotPayload, c.wantPayload)
+		}
+	}
+}
+
+func TestMapEventToOpUnknownTypeFallsBackToSetField(t *testing.T) {
+	row := map[string]interface{}{
+		"issue_id":   "bd-1",
+		"event_type": "priority_changed",
+		"old_value":  "low",
+		"new_value":  "high",
+	}
+
+	gotType, gotPayload := mapEventToOp(row)
+	if gotType != "set_field" {
+		t.Fatalf("mapEventToOp type = %q, want %q", gotType, "set_field")
+	}
+	want := map[string]any{
+		"issue_id":  "bd-1",
+		"field":     "priority_changed",
+		"old_value": "low",
+		"new_value": "high",
+	}
+	if !reflect.DeepEqual(gotPayload, want) {
+		t.Fatalf("mapEventToOp payload = %v, want %v", gotPayload, want)
+	}
+}
+
+func TestComputeOpIDStableAndSensitiveToPayload(t *testing.T) {
+	base := Op{Actor: "alice", Type: "create_issue", LamportClock: 1, Payload: map[string]any{"issue_id": "bd-1"}}
+
+	id1 := computeOpID(base)
+	id2 := computeOpID(base)
+	if id1 == "" {
+		t.Fatal("computeOpID returned empty string")
+	}
+	if id1 != id2 {
+		t.Fatalf("computeOpID is not stable: %q != %q", id1, id2)
+	}
+
+	changed := base
+	changed.Payload = map[string]any{"issue_id": "bd-2"}
+	if computeOpID(changed) == id1 {
+		t.Fatal("computeOpID did not change when payload changed")
+	}
+}
+
+func TestComputeOpIDIgnoresExistingOpID(t *testing.T) {
+	op := Op{Actor: "alice", Type: "create_issue", Payload: map[string]any{"issue_id": "bd-1"}}
+	withID := op
+	withID.OpID = "some-stale-id"
+
+	if computeOpID(op) != computeOpID(withID) {
+		t.Fatal("computeOpID should ignore the op's own OpID field")
+	}
+}
@@ -0,0 +1,584 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/steveyegge/beads/internal/backup/migrations"
+	"github.com/steveyegge/beads/internal/debug"
+)
+
+// dbExecer abstracts statement execution so callers can use a retry-wrapped
+// DoltStore.ExecContext instead of a raw *sql.DB or *sql.Tx.
+type dbExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// txBeginner is satisfied by stores that can hand out a *sql.Tx, letting
+// runBackupRestore wrap the whole restore in one Dolt transaction/commit.
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// RestoreOptions configures a restore run.
+type RestoreOptions struct {
+	// DryRun reports counts and conflicts without writing anything.
+	DryRun bool
+	// Since, when non-zero, restricts the restore to events with id > Since,
+	// the inverse of exportEventsSegment's high-water mark.
+	Since int64
+	// Wisps routes rows detected as wisp rows into the wisp_* tables.
+	Wisps bool
+}
+
+// RestoreConflict describes a row that could not be (or would not be) inserted
+// because a row with the same key already exists in the target table. ID is
+// the row's key column values (per tableKeyColumns), joined with "/" for
+// tables with a composite key.
+type RestoreConflict struct {
+	Table string `json:"table"`
+	ID    string `json:"id"`
+}
+
+// RestoreResult summarizes what a restore did (or, for a dry run, would do).
+type RestoreResult struct {
+	Counts    map[string]int    `json:"counts"`
+	Conflicts []RestoreConflict `json:"conflicts,omitempty"`
+}
+
+// restoreFile pairs a backup JSONL file with the table(s) it restores into.
+type restoreFile struct {
+	filename  string
+	table     string
+	wispTable string // empty if the table has no wisp counterpart
+}
+
+var restoreFiles = []restoreFile{
+	{"issues.jsonl", "issues", "wisps"},
+	{"comments.jsonl", "comments", "wisp_comments"},
+	{"dependencies.jsonl", "dependencies", "wisp_dependencies"},
+	{"labels.jsonl", "labels", "wisp_labels"},
+	{"config.jsonl", "config", ""},
+}
+
+// runBackupRestore replays the JSONL files produced by runBackupExport back
+// into a Dolt store via the configured BackupSink. It is the inverse of
+// runBackupExport: it reads backup_state.json to learn what was backed up,
+// queries dolt_log for the referenced Dolt commit (failing only if that query
+// errors; a commit absent from the target store is not rejected), and
+// streams issues.jsonl, comments.jsonl,
+// dependencies.jsonl, labels.jsonl, config.jsonl and the events/ segments
+// back into their tables using column-driven INSERT statements (mirroring
+// exportTable's dynamic column scanner).
+//
+// The whole restore runs inside a single Dolt transaction so a partial
+// restore (a bad row halfway through) can be rolled back cleanly: table
+// restores and the event restore that follows them share one execer, so
+// committing them is one atomic step rather than two.
+func runBackupRestore(ctx context.Context, opts RestoreOptions) (*RestoreResult, error) {
+	sink, err := newBackupSink(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := loadBackupState(sink)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := loadManifest(sink)
+	if err != nil {
+		return nil, err
+	}
+
+	if state.LastDoltCommit == "" {
+		debug.Logf("backup: restore target has no prior commit recorded, treating as fresh store\n")
+	} else if _, err := store.QueryContext(ctx, "SELECT 1 FROM dolt_log WHERE hash = ? LIMIT 1", state.LastDoltCommit); err != nil {
+		return nil, fmt.Errorf("failed to verify dolt commit %s: %w", truncateHash(state.LastDoltCommit), err)
+	}
+
+	all, err := migrations.All()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schema migrations: %w", err)
+	}
+
+	result := &RestoreResult{Counts: map[string]int{}}
+
+	if opts.Since > 0 {
+		tx, execer, err := beginRestoreTx(ctx, opts.DryRun)
+		if err != nil {
+			return nil, err
+		}
+		if tx != nil {
+			defer func() {
+				if tx != nil {
+					_ = tx.Rollback()
+				}
+			}()
+		}
+
+		n, conflicts, err := restoreEvents(ctx, execer, sink, manifest, state, all, opts)
+		if err != nil {
+			return nil, fmt.Errorf("restore events: %w", err)
+		}
+		result.Counts["events"] = n
+		result.Conflicts = append(result.Conflicts, conflicts...)
+
+		if tx != nil {
+			if err := tx.Commit(); err != nil {
+				return nil, fmt.Errorf("failed to commit restore transaction: %w", err)
+			}
+			tx = nil
+		}
+		return result, nil
+	}
+
+	tx, execer, err := beginRestoreTx(ctx, opts.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	if tx != nil {
+		defer func() {
+			if tx != nil {
+				_ = tx.Rollback()
+			}
+		}()
+	}
+
+	for _, rf := range restoreFiles {
+		n, conflicts, err := restoreTable(ctx, execer, sink, rf, manifest, state, all, opts)
+		if err != nil {
+			return nil, fmt.Errorf("restore %s: %w", rf.table, err)
+		}
+		result.Counts[rf.table] = n
+		result.Conflicts = append(result.Conflicts, conflicts...)
+	}
+
+	n, conflicts, err := restoreEvents(ctx, execer, sink, manifest, state, all, RestoreOptions{DryRun: opts.DryRun, Wisps: opts.Wisps})
+	if err != nil {
+		return nil, fmt.Errorf("restore events: %w", err)
+	}
+	result.Counts["events"] = n
+	result.Conflicts = append(result.Conflicts, conflicts...)
+
+	if !opts.DryRun {
+		if err := recordSchemaMigration(ctx, execer, state.SchemaVersion); err != nil {
+			return nil, fmt.Errorf("failed to record applied schema version: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit restore transaction: %w", err)
+		}
+		tx = nil
+	}
+
+	return result, nil
+}
+
+// beginRestoreTx opens the single transaction a restore runs in, or returns a
+// nil tx and execer for a dry run (which never writes). Both the Since-only
+// path and the full-restore path in runBackupRestore use this so table and
+// event restores always share one transaction rather than each opening their
+// own.
+func beginRestoreTx(ctx context.Context, dryRun bool) (*sql.Tx, dbExecer, error) {
+	if dryRun {
+		return nil, nil, nil
+	}
+	beginner, ok := store.(txBeginner)
+	if !ok {
+		return nil, nil, fmt.Errorf("store does not support transactions, cannot restore")
+	}
+	tx, err := beginner.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin restore transaction: %w", err)
+	}
+	return tx, tx, nil
+}
+
+// recordSchemaMigration records that a backup stamped with version has been
+// fully restored, creating the backup_migrations log table on first use. The
+// table is only written here; runBackupRestore does not read it back, so a
+// restore does not skip versions already recorded in it.
+// The table has no uniqueness constraint on version: restoring the same
+// backup twice should append, not conflict.
+func recordSchemaMigration(ctx context.Context, execer dbExecer, version int) error {
+	if err := ensureBackupTable(ctx, execer, "backup_migrations",
+		"CREATE TABLE backup_migrations (version INT NOT NULL, applied_at VARCHAR(40) NOT NULL)"); err != nil {
+		return err
+	}
+	_, err := execer.ExecContext(ctx,
+		"INSERT INTO backup_migrations (version, applied_at) VALUES (?, ?)",
+		version, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// restoreTable streams one backup JSONL file back into its table, routing
+// rows tagged as wisp rows (per isWispRow) into the wisp table when
+// opts.Wisps is set and that wisp table exists. Each row is passed through
+// migrations.Apply first, bringing it from state.SchemaVersion up to the
+// newest schema this binary knows about.
+func restoreTable(ctx context.Context, execer dbExecer, sink BackupSink, rf restoreFile, manifest *backupManifest, state *backupState, all []migrations.Migration, opts RestoreOptions) (int, []RestoreConflict, error) {
+	data, err := readJSONLFile(sink, rf.filename, fileEncryption(manifest, rf.filename))
+	if os.IsNotExist(err) {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to open %s: %w", rf.filename, err)
+	}
+
+	useWisps := opts.Wisps && rf.wispTable != "" && tableExistsCheck(ctx, store, rf.wispTable)
+
+	existingByTable := map[string]map[string]bool{}
+	if opts.DryRun {
+		tables := []string{rf.table}
+		if useWisps {
+			tables = append(tables, rf.wispTable)
+		}
+		for _, t := range tables {
+			ids, err := existingIDs(ctx, t)
+			if err != nil {
+				return 0, nil, err
+			}
+			existingByTable[t] = ids
+		}
+	}
+
+	count := 0
+	var conflicts []RestoreConflict
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var row map[string]any
+		if err := json.Unmarshal(line, &row); err != nil {
+			return 0, nil, fmt.Errorf("failed to parse row in %s: %w", rf.filename, err)
+		}
+		row, err = migrations.Apply(all, state.SchemaVersion, row)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to migrate row in %s: %w", rf.filename, err)
+		}
+
+		table := rf.table
+		if useWisps && isWispRow(row) {
+			table = rf.wispTable
+		}
+
+		if opts.DryRun {
+			if parts, ok := rowKeyParts(table, row); ok && existingByTable[table][compositeKey(parts)] {
+				conflicts = append(conflicts, RestoreConflict{Table: table, ID: strings.Join(parts, "/")})
+			}
+			count++
+			continue
+		}
+
+		query, args := buildInsert(table, row)
+		if _, err := execer.ExecContext(ctx, query, args...); err != nil {
+			return 0, nil, fmt.Errorf("insert into %s failed: %w", table, err)
+		}
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, nil, fmt.Errorf("failed to read %s: %w", rf.filename, err)
+	}
+
+	return count, conflicts, nil
+}
+
+// restoreEvents replays every events/ segment on sink in ascending run order,
+// optionally restricted to events with id > opts.Since, the natural inverse
+// of exportEventsSegment's high-water mark. It does not manage its own
+// transaction: the caller passes in the execer to use (possibly nil for a dry
+// run), so a full restore can run table and event restores inside one
+// transaction (see runBackupRestore and beginRestoreTx). Each row is passed
+// through migrations.Apply, same as restoreTable.
+func restoreEvents(ctx context.Context, execer dbExecer, sink BackupSink, manifest *backupManifest, state *backupState, all []migrations.Migration, opts RestoreOptions) (int, []RestoreConflict, error) {
+	segments, err := eventsSegments(sink)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	useWisps := opts.Wisps && tableExistsCheck(ctx, store, "wisp_events")
+
+	existingByTable := map[string]map[string]bool{}
+	if opts.DryRun {
+		tables := []string{"events"}
+		if useWisps {
+			tables = append(tables, "wisp_events")
+		}
+		for _, t := range tables {
+			ids, err := existingIDs(ctx, t)
+			if err != nil {
+				return 0, nil, err
+			}
+			existingByTable[t] = ids
+		}
+	}
+
+	count := 0
+	var conflicts []RestoreConflict
+
+	for _, name := range segments {
+		data, err := readJSONLFile(sink, name, fileEncryption(manifest, name))
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to open %s: %w", name, err)
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+			var row map[string]any
+			if err := json.Unmarshal(line, &row); err != nil {
+				return 0, nil, fmt.Errorf("failed to parse row in %s: %w", name, err)
+			}
+			row, err = migrations.Apply(all, state.SchemaVersion, row)
+			if err != nil {
+				return 0, nil, fmt.Errorf("failed to migrate row in %s: %w", name, err)
+			}
+
+			id, _ := row["id"].(float64)
+			if opts.Since > 0 && int64(id) <= opts.Since {
+				continue
+			}
+
+			table := "events"
+			if useWisps && isWispRow(row) {
+				table = "wisp_events"
+			}
+
+			if opts.DryRun {
+				if parts, ok := rowKeyParts(table, row); ok && existingByTable[table][compositeKey(parts)] {
+					conflicts = append(conflicts, RestoreConflict{Table: table, ID: strings.Join(parts, "/")})
+				}
+				count++
+				continue
+			}
+
+			query, args := buildInsert(table, row)
+			if _, err := execer.ExecContext(ctx, query, args...); err != nil {
+				return 0, nil, fmt.Errorf("insert into %s failed: %w", table, err)
+			}
+			count++
+		}
+		if err := scanner.Err(); err != nil {
+			return 0, nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+	}
+
+	return count, conflicts, nil
+}
+
+// legacyEventsFilename is the single, incrementally-appended events file
+// written by backups predating the events/NNNNNN.jsonl segments (see
+// eventsSegments).
+const legacyEventsFilename = "events.jsonl"
+
+// eventsSegments returns the names of all events/*.jsonl segments on sink,
+// sorted in ascending run order. If sink has none but has a legacy flat
+// events.jsonl (from a backup predating the segmented format), that single
+// file is returned instead, so restoring an old backup directory doesn't
+// silently skip every event.
+func eventsSegments(sink BackupSink) ([]string, error) {
+	names, err := sink.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backup files: %w", err)
+	}
+	var segments []string
+	var hasLegacy bool
+	for _, name := range names {
+		switch {
+		case strings.HasPrefix(name, "events/") && strings.HasSuffix(name, ".jsonl"):
+			segments = append(segments, name)
+		case name == legacyEventsFilename:
+			hasLegacy = true
+		}
+	}
+	sort.Strings(segments)
+	if len(segments) == 0 && hasLegacy {
+		return []string{legacyEventsFilename}, nil
+	}
+	return segments, nil
+}
+
+// isWispRow reports whether a decoded backup row belongs to a wisp rather
+// than a regular issue, based on the "bd-"-vs-other prefix convention used
+// for issue IDs. Rows without a string id are never treated as wisps.
+func isWispRow(row map[string]any) bool {
+	id, ok := row["id"].(string)
+	if !ok {
+		return false
+	}
+	return !strings.HasPrefix(id, "bd-")
+}
+
+// tableKeyColumns maps each restorable (or dedup-tracking) table to the
+// column(s) that make a row unique, so existingIDs and rowKeyParts agree on
+// what "already exists" means. dependencies and labels have no single id
+// column at all, so their key is composite.
+var tableKeyColumns = map[string][]string{
+	"issues":             {"id"},
+	"wisps":              {"id"},
+	"comments":           {"id"},
+	"wisp_comments":      {"id"},
+	"dependencies":       {"issue_id", "depends_on_id"},
+	"wisp_dependencies":  {"issue_id", "depends_on_id"},
+	"labels":             {"issue_id", "label"},
+	"wisp_labels":        {"issue_id", "label"},
+	"config":             {"key"},
+	"events":             {"id"},
+	"wisp_events":        {"id"},
+	"backup_applied_ops": {"op_id"},
+}
+
+// rowKeyParts extracts table's key column values from a decoded backup row,
+// per tableKeyColumns. ok is false if table has no registered key or row is
+// missing one of the key fields.
+func rowKeyParts(table string, row map[string]any) (parts []string, ok bool) {
+	cols, known := tableKeyColumns[table]
+	if !known {
+		return nil, false
+	}
+	parts = make([]string, len(cols))
+	for i, c := range cols {
+		v, present := row[c]
+		if !present {
+			return nil, false
+		}
+		parts[i] = fmt.Sprint(v)
+	}
+	return parts, true
+}
+
+// compositeKey joins key column values into a single map key, using a
+// separator that can't appear in a fmt.Sprint of a normal column value.
+func compositeKey(parts []string) string {
+	return strings.Join(parts, "\x00")
+}
+
+// existingIDs returns the set of rows already present in table, keyed by
+// compositeKey over table's registered key columns (see tableKeyColumns),
+// used by dry-run restores to detect conflicts without writing anything. It
+// returns an error rather than swallowing one, since a dry run that silently
+// reports zero conflicts on a query failure is worse than one that fails
+// loudly.
+func existingIDs(ctx context.Context, table string) (map[string]bool, error) {
+	cols, ok := tableKeyColumns[table]
+	if !ok {
+		return nil, fmt.Errorf("existingIDs: no key columns registered for table %q", table)
+	}
+	quoted := make([]string, len(cols))
+	for i, c := range cols {
+		quoted[i] = "`" + c + "`"
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoted, ", "), table) //nolint:gosec // table/cols come from tableKeyColumns, not user input
+	rows, err := store.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query existing %s rows: %w", table, err)
+	}
+	defer rows.Close()
+
+	ids := map[string]bool{}
+	for rows.Next() {
+		values := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, fmt.Errorf("failed to scan existing %s row: %w", table, err)
+		}
+		parts := make([]string, len(cols))
+		for i, v := range values {
+			parts[i] = fmt.Sprint(normalizeValue(v))
+		}
+		ids[compositeKey(parts)] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate existing %s rows: %w", table, err)
+	}
+	return ids, nil
+}
+
+// buildInsert builds a column-name-driven INSERT statement for row, mirroring
+// the dynamic column scanner in exportTable. Columns are sorted for
+// deterministic statement generation.
+func buildInsert(table string, row map[string]any) (string, []any) {
+	cols := make([]string, 0, len(row))
+	for col := range row {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+
+	quoted := make([]string, len(cols))
+	placeholders := make([]string, len(cols))
+	args := make([]any, len(cols))
+	for i, col := range cols {
+		quoted[i] = "`" + col + "`"
+		placeholders[i] = "?"
+		args[i] = jsonToSQLValue(row[col])
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(quoted, ", "), strings.Join(placeholders, ", "))
+	return query, args
+}
+
+// jsonToSQLValue converts a value decoded from a backup JSONL row (as
+// produced by encoding/json) back into a value suitable for a SQL driver arg.
+// JSON numbers decode as float64; integral ones are converted back to int64
+// so they round-trip through integer columns cleanly.
+func jsonToSQLValue(v any) any {
+	if f, ok := v.(float64); ok && f == float64(int64(f)) {
+		return int64(f)
+	}
+	return v
+}
+
+var (
+	backupRestoreDryRun bool
+	backupRestoreSince  int64
+	backupRestoreWisps  bool
+)
+
+var backupRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Replay a backup's JSONL files back into this store",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		result, err := runBackupRestore(cmd.Context(), RestoreOptions{
+			DryRun: backupRestoreDryRun,
+			Since:  backupRestoreSince,
+			Wisps:  backupRestoreWisps,
+		})
+		if err != nil {
+			return err
+		}
+		for _, rf := range restoreFiles {
+			fmt.Fprintf(cmd.OutOrStdout(), "%s: %d row(s)\n", rf.table, result.Counts[rf.table])
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "events: %d row(s)\n", result.Counts["events"])
+		for _, c := range result.Conflicts {
+			fmt.Fprintf(cmd.OutOrStdout(), "conflict: %s id=%s already exists\n", c.Table, c.ID)
+		}
+		return nil
+	},
+}
+
+func init() {
+	backupRestoreCmd.Flags().BoolVar(&backupRestoreDryRun, "dry-run", false, "report counts and conflicts without writing anything")
+	backupRestoreCmd.Flags().Int64Var(&backupRestoreSince, "since", 0, "restore only events with id greater than this value")
+	backupRestoreCmd.Flags().BoolVar(&backupRestoreWisps, "wisps", false, "route rows detected as wisp rows into the wisp_* tables")
+	backupCmd.AddCommand(backupRestoreCmd)
+}
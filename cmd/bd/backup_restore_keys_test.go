@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildInsertSortsAndQuotesColumns(t *testing.T) {
+	query, args := buildInsert("issues", map[string]any{"title": "fix bug", "id": "bd-1"})
+
+	wantQuery := "INSERT INTO issues (`id`, `title`) VALUES (?, ?)"
+	if query != wantQuery {
+		t.Fatalf("buildInsert query = %q, want %q", query, wantQuery)
+	}
+	wantArgs := []any{"bd-1", "fix bug"}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Fatalf("buildInsert args = %v, want %v", args, wantArgs)
+	}
+}
+
+func TestRowKeyPartsCompositeKey(t *testing.T) {
+	row := map[string]any{"issue_id": "bd-1", "depends_on_id": "bd-2", "extra": "ignored"}
+
+	parts, ok := rowKeyParts("dependencies", row)
+	if !ok {
+		t.Fatal("rowKeyParts: ok = false, want true")
+	}
+	want := []string{"bd-1", "bd-2"}
+	if !reflect.DeepEqual(parts, want) {
+		t.Fatalf("rowKeyParts() = %v, want %v", parts, want)
+	}
+}
+
+func TestRowKeyPartsMissingColumnIsNotOK(t *testing.T) {
+	if _, ok := rowKeyParts("labels", map[string]any{"issue_id": "bd-1"}); ok {
+		t.Fatal("rowKeyParts: ok = true for row missing the label column, want false")
+	}
+}
+
+func TestRowKeyPartsUnknownTableIsNotOK(t *testing.T) {
+	if _, ok := rowKeyParts("some_other_table", map[string]any{"id": "1"}); ok {
+		t.Fatal("rowKeyParts: ok = true for a table with no registered key columns, want false")
+	}
+}
+
+func TestCompositeKeyJoinsWithUnambiguousSeparator(t *testing.T) {
+	a := compositeKey([]string{"a", "b"})
+	b := compositeKey([]string{"a,b"})
+	if a == b {
+		t.Fatalf("compositeKey collided: %q == %q", a, b)
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"google.golang.org/api/iterator"
+
+	"github.com/steveyegge/beads/internal/config"
+)
+
+// BackupSink abstracts where backup files live, so runBackupExport and
+// restore code can target a local directory, an S3 bucket, a GCS bucket,
+// or a MinIO (or other S3-compatible) endpoint without caring which.
+//
+// Implementations must make AtomicWrite atomic: a reader must never observe
+// a partially-written file. file:// does this with a temp-file-then-rename;
+// the cloud schemes do it by uploading to a temporary key and copying it to
+// the final key once the upload completes.
+type BackupSink interface {
+	// OpenWrite returns a writer for name. Callers that want atomicity
+	// should prefer AtomicWrite; OpenWrite is for streaming writes where the
+	// caller already manages that (e.g. a growing local file).
+	OpenWrite(name string) (io.WriteCloser, error)
+	// Read opens name for reading.
+	Read(name string) (io.ReadCloser, error)
+	// AtomicWrite writes data to name such that readers never see a partial file.
+	AtomicWrite(name string, data []byte) error
+	// List returns the names of all files in the sink.
+	List() ([]string, error)
+}
+
+// newBackupSink resolves the BackupSink to use, selected by the
+// "backup.destination" config key's URI scheme:
+//
+//	(unset)                     local .beads/backup/ or backup.git-repo, as before
+//	file:///absolute/path       a local directory
+//	s3://bucket/prefix          an S3 bucket
+//	gs://bucket/prefix          a GCS bucket
+//	minio://endpoint/bucket/prefix  a MinIO (or other S3-compatible) endpoint
+func newBackupSink(ctx context.Context) (BackupSink, error) {
+	dest := config.GetString("backup.destination")
+	if dest == "" {
+		dir, err := backupDir()
+		if err != nil {
+			return nil, err
+		}
+		return &fileSink{dir: dir}, nil
+	}
+
+	scheme, rest, ok := strings.Cut(dest, "://")
+	if !ok {
+		return nil, fmt.Errorf("invalid backup.destination %q: expected scheme://...", dest)
+	}
+
+	switch scheme {
+	case "file":
+		if err := os.MkdirAll(rest, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create backup directory: %w", err)
+		}
+		return &fileSink{dir: rest}, nil
+	case "s3":
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		cfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		return &s3Sink{bucket: bucket, prefix: prefix, client: s3.NewFromConfig(cfg)}, nil
+	case "gs":
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		client, err := storage.NewClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GCS client: %w", err)
+		}
+		return &gcsSink{bucket: bucket, prefix: prefix, client: client}, nil
+	case "minio":
+		endpoint, pathPart, ok := strings.Cut(rest, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid minio destination %q: expected minio://endpoint/bucket/prefix", dest)
+		}
+		bucket, prefix, _ := strings.Cut(pathPart, "/")
+		client, err := minio.New(endpoint, &minio.Options{
+			Creds:  credentials.NewEnvMinio(),
+			Secure: true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create MinIO client: %w", err)
+		}
+		return &minioSink{bucket: bucket, prefix: prefix, client: client}, nil
+	default:
+		return nil, fmt.Errorf("unknown backup.destination scheme %q", scheme)
+	}
+}
+
+// fileSink is the file-scheme BackupSink, writing via temp-file-then-rename,
+// rooted at dir (either a git-repo backup/ subdirectory or
+// .beads/backup/, per backupDir's existing resolution).
+type fileSink struct{ dir string }
+
+func (s *fileSink) path(name string) string { return filepath.Join(s.dir, filepath.FromSlash(name)) }
+
+func (s *fileSink) OpenWrite(name string) (io.WriteCloser, error) {
+	p := s.path(name)
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600) //nolint:gosec // path is constructed internally
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	return f, nil
+}
+
+func (s *fileSink) Read(name string) (io.ReadCloser, error) {
+	f, err := os.Open(s.path(name)) //nolint:gosec // path is constructed internally
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// AtomicWrite writes data to a temp file in the target directory and
+// renames it into place (crash-safe).
+func (s *fileSink) AtomicWrite(name string, data []byte) error {
+	p := s.path(name)
+	dir := filepath.Dir(p)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".backup-tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Rename(tmpPath, p); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	return nil
+}
+
+func (s *fileSink) List() ([]string, error) {
+	var names []string
+	err := filepath.Walk(s.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, p)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backup directory: %w", err)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// s3Sink stores backup files as objects under bucket/prefix/name.
+// AtomicWrite uploads to a temporary key and copies it to the final key,
+// since S3 has no atomic rename: a half-uploaded object at the final key
+// would otherwise be observable to a concurrent reader.
+type s3Sink struct {
+	bucket string
+	prefix string
+	client *s3.Client
+}
+
+func (s *s3Sink) key(name string) string { return path.Join(s.prefix, name) }
+
+func (s *s3Sink) OpenWrite(name string) (io.WriteCloser, error) {
+	return &bufferedSinkWriter{flush: func(data []byte) error { return s.AtomicWrite(name, data) }}, nil
+}
+
+func (s *s3Sink) Read(name string) (io.ReadCloser, error) {
+	ctx := context.Background()
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(s.key(name))})
+	if err != nil {
+		return nil, fmt.Errorf("s3 get %s: %w", name, err)
+	}
+	return out.Body, nil
+}
+
+func (s *s3Sink) AtomicWrite(name string, data []byte) error {
+	ctx := context.Background()
+	tmpKey := s.key(name) + ".tmp-upload"
+	finalKey := s.key(name)
+
+	if _, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket), Key: aws.String(tmpKey), Body: bytes.NewReader(data),
+	}); err != nil {
+		return fmt.Errorf("s3 put %s: %w", name, err)
+	}
+	if _, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket: aws.String(s.bucket), Key: aws.String(finalKey),
+		CopySource: aws.String(s.bucket + "/" + tmpKey),
+	}); err != nil {
+		return fmt.Errorf("s3 copy %s into place: %w", name, err)
+	}
+	_, _ = s.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(tmpKey)})
+	return nil
+}
+
+func (s *s3Sink) List() ([]string, error) {
+	ctx := context.Background()
+	var names []string
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket), Prefix: aws.String(s.prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("s3 list: %w", err)
+		}
+		for _, obj := range page.Contents {
+			rel := strings.TrimPrefix(aws.ToString(obj.Key), s.prefix+"/")
+			if strings.HasSuffix(rel, ".tmp-upload") {
+				continue
+			}
+			names = append(names, rel)
+		}
+	}
+	return names, nil
+}
+
+// gcsSink stores backup files as objects under bucket/prefix/name, using the
+// same upload-to-temp-then-copy pattern as s3Sink for atomicity.
+type gcsSink struct {
+	bucket string
+	prefix string
+	client *storage.Client
+}
+
+func (s *gcsSink) key(name string) string { return path.Join(s.prefix, name) }
+
+func (s *gcsSink) OpenWrite(name string) (io.WriteCloser, error) {
+	return &bufferedSinkWriter{flush: func(data []byte) error { return s.AtomicWrite(name, data) }}, nil
+}
+
+func (s *gcsSink) Read(name string) (io.ReadCloser, error) {
+	ctx := context.Background()
+	r, err := s.client.Bucket(s.bucket).Object(s.key(name)).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("gcs get %s: %w", name, err)
+	}
+	return r, nil
+}
+
+func (s *gcsSink) AtomicWrite(name string, data []byte) error {
+	ctx := context.Background()
+	bucket := s.client.Bucket(s.bucket)
+	tmpObj := bucket.Object(s.key(name) + ".tmp-upload")
+	finalObj := bucket.Object(s.key(name))
+
+	w := tmpObj.NewWriter(ctx)
+	if _, err := w.Write(data); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("gcs put %s: %w", name, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("gcs put %s: %w", name, err)
+	}
+	if _, err := finalObj.CopierFrom(tmpObj).Run(ctx); err != nil {
+		return fmt.Errorf("gcs copy %s into place: %w", name, err)
+	}
+	_ = tmpObj.Delete(ctx)
+	return nil
+}
+
+func (s *gcsSink) List() ([]string, error) {
+	ctx := context.Background()
+	var names []string
+	it := s.client.Bucket(s.bucket).Objects(ctx, &storage.Query{Prefix: s.prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("gcs list: %w", err)
+		}
+		rel := strings.TrimPrefix(attrs.Name, s.prefix+"/")
+		if strings.HasSuffix(rel, ".tmp-upload") {
+			continue
+		}
+		names = append(names, rel)
+	}
+	return names, nil
+}
+
+// minioSink is an S3-compatible sink for MinIO or any other S3-API-speaking
+// object store, using the same temp-key-then-copy atomicity pattern.
+type minioSink struct {
+	bucket string
+	prefix string
+	client *minio.Client
+}
+
+func (s *minioSink) key(name string) string { return path.Join(s.prefix, name) }
+
+func (s *minioSink) OpenWrite(name string) (io.WriteCloser, error) {
+	return &bufferedSinkWriter{flush: func(data []byte) error { return s.AtomicWrite(name, data) }}, nil
+}
+
+func (s *minioSink) Read(name string) (io.ReadCloser, error) {
+	ctx := context.Background()
+	obj, err := s.client.GetObject(ctx, s.bucket, s.key(name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("minio get %s: %w", name, err)
+	}
+	return obj, nil
+}
+
+func (s *minioSink) AtomicWrite(name string, data []byte) error {
+	ctx := context.Background()
+	tmpKey := s.key(name) + ".tmp-upload"
+	finalKey := s.key(name)
+
+	if _, err := s.client.PutObject(ctx, s.bucket, tmpKey, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{}); err != nil {
+		return fmt.Errorf("minio put %s: %w", name, err)
+	}
+	dst := minio.CopyDestOptions{Bucket: s.bucket, Object: finalKey}
+	src := minio.CopySrcOptions{Bucket: s.bucket, Object: tmpKey}
+	if _, err := s.client.CopyObject(ctx, dst, src); err != nil {
+		return fmt.Errorf("minio copy %s into place: %w", name, err)
+	}
+	_ = s.client.RemoveObject(ctx, s.bucket, tmpKey, minio.RemoveObjectOptions{})
+	return nil
+}
+
+func (s *minioSink) List() ([]string, error) {
+	ctx := context.Background()
+	var names []string
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("minio list: %w", obj.Err)
+		}
+		rel := strings.TrimPrefix(obj.Key, s.prefix+"/")
+		if strings.HasSuffix(rel, ".tmp-upload") {
+			continue
+		}
+		names = append(names, rel)
+	}
+	return names, nil
+}
+
+// bufferedSinkWriter buffers everything written to it in memory and hands
+// the whole buffer to flush on Close, giving cloud sinks an OpenWrite that
+// still goes through their atomic upload-then-copy path.
+type bufferedSinkWriter struct {
+	buf   bytes.Buffer
+	flush func([]byte) error
+}
+
+func (w *bufferedSinkWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+func (w *bufferedSinkWriter) Close() error                { return w.flush(w.buf.Bytes()) }
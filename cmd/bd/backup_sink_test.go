@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io"
+	"testing"
+)
+
+func TestFileSinkAtomicWriteAndRead(t *testing.T) {
+	s := &fileSink{dir: t.TempDir()}
+
+	if err := s.AtomicWrite("issues.jsonl", []byte("hello")); err != nil {
+		t.Fatalf("AtomicWrite: %v", err)
+	}
+
+	r, err := s.Read("issues.jsonl")
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got) != "hello" {
+		t.Fatalf("Read returned %q, want %q", got, "hello")
+	}
+}
+
+func TestFileSinkAtomicWriteNestedName(t *testing.T) {
+	s := &fileSink{dir: t.TempDir()}
+
+	if err := s.AtomicWrite("events/000001.jsonl", []byte("segment")); err != nil {
+		t.Fatalf("AtomicWrite: %v", err)
+	}
+
+	r, err := s.Read("events/000001.jsonl")
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got) != "segment" {
+		t.Fatalf("Read returned %q, want %q", got, "segment")
+	}
+}
+
+func TestFileSinkListSortedAndSlashed(t *testing.T) {
+	s := &fileSink{dir: t.TempDir()}
+
+	for _, name := range []string{"issues.jsonl", "events/000002.jsonl", "events/000001.jsonl"} {
+		if err := s.AtomicWrite(name, []byte("x")); err != nil {
+			t.Fatalf("AtomicWrite(%s): %v", name, err)
+		}
+	}
+
+	names, err := s.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	want := []string{"events/000001.jsonl", "events/000002.jsonl", "issues.jsonl"}
+	if len(names) != len(want) {
+		t.Fatalf("List() = %v, want %v", names, want)
+	}
+	for i, n := range names {
+		if n != want[i] {
+			t.Fatalf("List() = %v, want %v", names, want)
+		}
+	}
+}
+
+func TestFileSinkListMissingDirReturnsNoError(t *testing.T) {
+	s := &fileSink{dir: t.TempDir() + "/does-not-exist"}
+
+	names, err := s.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if names != nil {
+		t.Fatalf("List() = %v, want nil", names)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestRunBackupVerifyOKChain(t *testing.T) {
+	s := &fileSink{dir: t.TempDir()}
+	if err := s.AtomicWrite("issues.jsonl", []byte("hello")); err != nil {
+		t.Fatalf("AtomicWrite: %v", err)
+	}
+	entry := ManifestEntry{RunID: "run1", Files: []ManifestFile{{Name: "issues.jsonl", SHA256: sha256Hex([]byte("hello"))}}}
+	if err := appendManifestEntry(s, entry); err != nil {
+		t.Fatalf("appendManifestEntry: %v", err)
+	}
+
+	results, err := runBackupVerify(s)
+	if err != nil {
+		t.Fatalf("runBackupVerify: %v", err)
+	}
+	if len(results) != 1 || !results[0].OK {
+		t.Fatalf("runBackupVerify() = %+v, want one OK result", results)
+	}
+}
+
+func TestRunBackupVerifyDetectsCorruption(t *testing.T) {
+	s := &fileSink{dir: t.TempDir()}
+	if err := s.AtomicWrite("issues.jsonl", []byte("hello")); err != nil {
+		t.Fatalf("AtomicWrite: %v", err)
+	}
+	entry := ManifestEntry{RunID: "run1", Files: []ManifestFile{{Name: "issues.jsonl", SHA256: sha256Hex([]byte("hello"))}}}
+	if err := appendManifestEntry(s, entry); err != nil {
+		t.Fatalf("appendManifestEntry: %v", err)
+	}
+
+	// Corrupt the file after the manifest was written against its original contents.
+	if err := s.AtomicWrite("issues.jsonl", []byte("corrupted")); err != nil {
+		t.Fatalf("AtomicWrite: %v", err)
+	}
+
+	results, err := runBackupVerify(s)
+	if err != nil {
+		t.Fatalf("runBackupVerify: %v", err)
+	}
+	if len(results) != 1 || results[0].OK || results[0].Err == nil {
+		t.Fatalf("runBackupVerify() = %+v, want one failing result with an error", results)
+	}
+}
+
+func TestRunBackupVerifyReportsMissingFile(t *testing.T) {
+	s := &fileSink{dir: t.TempDir()}
+	entry := ManifestEntry{RunID: "run1", Files: []ManifestFile{{Name: "issues.jsonl", SHA256: "deadbeef"}}}
+	if err := appendManifestEntry(s, entry); err != nil {
+		t.Fatalf("appendManifestEntry: %v", err)
+	}
+
+	results, err := runBackupVerify(s)
+	if err != nil {
+		t.Fatalf("runBackupVerify: %v", err)
+	}
+	if len(results) != 1 || results[0].OK || results[0].Err == nil {
+		t.Fatalf("runBackupVerify() = %+v, want one failing result for the missing file", results)
+	}
+}
@@ -0,0 +1,134 @@
+// Package migrations defines the schema-versioned transforms applied to
+// backup JSONL records so a newer beads binary restoring an older backup
+// brings each row up to its current schema instead of choking on columns
+// added since. Transforms only run forward: rows of a backup newer than the
+// restoring binary are left unchanged.
+//
+// Each schema change is one embedded JSON file named "NN-name.json" (e.g.
+// "01-add-priority.json"), numbered consecutively starting at 0. Most schema
+// changes are a simple field add/rename/remove, so contributors add a single
+// file rather than writing Go code; see migrationSpec for the supported
+// operations.
+package migrations
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//go:embed *.json
+var migrationFiles embed.FS
+
+// Migration is one numbered schema change. Up must be idempotent: applying
+// it twice to an already-migrated row must be a no-op, since a restore may
+// be resumed after a partial failure.
+type Migration interface {
+	ID() int
+	Name() string
+	Up(row map[string]any) (map[string]any, error)
+}
+
+// migrationSpec is the on-disk JSON shape of each "NN-name.json" file.
+type migrationSpec struct {
+	ID           int               `json:"id"`
+	Name         string            `json:"name"`
+	AddFields    map[string]any    `json:"add_fields,omitempty"`
+	RenameFields map[string]string `json:"rename_fields,omitempty"`
+	RemoveFields []string          `json:"remove_fields,omitempty"`
+}
+
+// jsonMigration implements Migration by applying a migrationSpec's
+// add/rename/remove field operations, in that order, to a copy of the row.
+type jsonMigration struct{ spec migrationSpec }
+
+func (m *jsonMigration) ID() int      { return m.spec.ID }
+func (m *jsonMigration) Name() string { return m.spec.Name }
+
+func (m *jsonMigration) Up(row map[string]any) (map[string]any, error) {
+	out := make(map[string]any, len(row))
+	for k, v := range row {
+		out[k] = v
+	}
+	for field, def := range m.spec.AddFields {
+		if _, ok := out[field]; !ok {
+			out[field] = def
+		}
+	}
+	for oldName, newName := range m.spec.RenameFields {
+		if v, ok := out[oldName]; ok {
+			out[newName] = v
+			delete(out, oldName)
+		}
+	}
+	for _, field := range m.spec.RemoveFields {
+		delete(out, field)
+	}
+	return out, nil
+}
+
+// All returns every registered migration, sorted by ID ascending. It errors
+// if the embedded migrations aren't numbered consecutively from 0, since
+// Apply and CurrentVersion both assume a migration's ID is also its index.
+func All() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir(".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded migrations: %w", err)
+	}
+
+	var all []Migration
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := migrationFiles.ReadFile(e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", e.Name(), err)
+		}
+		var spec migrationSpec
+		if err := json.Unmarshal(data, &spec); err != nil {
+			return nil, fmt.Errorf("failed to parse migration %s: %w", e.Name(), err)
+		}
+		all = append(all, &jsonMigration{spec: spec})
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].ID() < all[j].ID() })
+	for i, m := range all {
+		if m.ID() != i {
+			return nil, fmt.Errorf("migration %q has id %d, expected %d (migrations must be numbered consecutively from 0)", m.Name(), m.ID(), i)
+		}
+	}
+	return all, nil
+}
+
+// CurrentVersion is the schema version to stamp into a new backup: the ID of
+// the newest registered migration, or -1 if none are registered.
+func CurrentVersion() (int, error) {
+	all, err := All()
+	if err != nil {
+		return 0, err
+	}
+	if len(all) == 0 {
+		return -1, nil
+	}
+	return all[len(all)-1].ID(), nil
+}
+
+// Apply runs every migration newer than fromVersion, in order, over row.
+// fromVersion is the schema_version a backup was stamped with; rows pass
+// through migrations unchanged if fromVersion is already current.
+func Apply(all []Migration, fromVersion int, row map[string]any) (map[string]any, error) {
+	for _, m := range all {
+		if m.ID() <= fromVersion {
+			continue
+		}
+		var err error
+		row, err = m.Up(row)
+		if err != nil {
+			return nil, fmt.Errorf("migration %d (%s) failed: %w", m.ID(), m.Name(), err)
+		}
+	}
+	return row, nil
+}
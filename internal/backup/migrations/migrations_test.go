@@ -0,0 +1,73 @@
+package migrations
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAllNumberedConsecutively(t *testing.T) {
+	all, err := All()
+	if err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	for i, m := range all {
+		if m.ID() != i {
+			t.Fatalf("migration at index %d has id %d, want %d", i, m.ID(), i)
+		}
+	}
+}
+
+func TestApplyRunsInOrder(t *testing.T) {
+	migs := []Migration{
+		&jsonMigration{spec: migrationSpec{ID: 0, Name: "init"}},
+		&jsonMigration{spec: migrationSpec{ID: 1, Name: "add-priority", AddFields: map[string]any{"priority": "medium"}}},
+		&jsonMigration{spec: migrationSpec{ID: 2, Name: "rename-priority", RenameFields: map[string]string{"priority": "pri"}}},
+	}
+
+	got, err := Apply(migs, -1, map[string]any{"id": "bd-1"})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	want := map[string]any{"id": "bd-1", "pri": "medium"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Apply() = %v, want %v", got, want)
+	}
+}
+
+func TestApplySkipsMigrationsAtOrBelowFromVersion(t *testing.T) {
+	migs := []Migration{
+		&jsonMigration{spec: migrationSpec{ID: 0, Name: "init"}},
+		&jsonMigration{spec: migrationSpec{ID: 1, Name: "add-priority", AddFields: map[string]any{"priority": "medium"}}},
+	}
+
+	row := map[string]any{"id": "bd-1", "priority": "high"}
+	got, err := Apply(migs, 1, row)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if got["priority"] != "high" {
+		t.Fatalf("Apply touched a row already at the current schema version: got %v", got)
+	}
+}
+
+func TestJSONMigrationUpIsIdempotent(t *testing.T) {
+	m := &jsonMigration{spec: migrationSpec{
+		ID:           1,
+		Name:         "add-and-rename",
+		AddFields:    map[string]any{"priority": "medium"},
+		RenameFields: map[string]string{"old_name": "new_name"},
+	}}
+
+	row := map[string]any{"id": "bd-1"}
+	first, err := m.Up(row)
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	second, err := m.Up(first)
+	if err != nil {
+		t.Fatalf("Up (second application): %v", err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("Up is not idempotent: first=%v second=%v", first, second)
+	}
+}